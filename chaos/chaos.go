@@ -0,0 +1,56 @@
+// Package chaos provides an optional fault-injection layer for connections,
+// analogous to the linkio/monkey pattern used by MailHog-style SMTP
+// servers. It lets integration tests reproduce slow-client and
+// flaky-network scenarios without external tooling.
+package chaos
+
+import "math/rand"
+
+// ChaosMonkey decides how an accepted connection should misbehave.
+type ChaosMonkey interface {
+	// LinkSpeed returns the link's simulated throughput in bytes/sec, or
+	// nil if the link should run unthrottled.
+	LinkSpeed() *int
+	// AllowCommand reports whether cmd should be allowed to execute, or be
+	// dropped as a simulated command failure.
+	AllowCommand(cmd string) bool
+	// Disconnect reports whether the connection should be severed before
+	// the next command is handled.
+	Disconnect() bool
+}
+
+// Config configures a Monkey.
+type Config struct {
+	LinkSpeedBps   int     // Simulated link speed in bytes/sec; 0 means unthrottled.
+	DropRate       float64 // Probability, in [0,1], that AllowCommand refuses a command.
+	DisconnectRate float64 // Probability, in [0,1], that Disconnect severs the connection.
+}
+
+// Monkey is the default ChaosMonkey, driven by randomized rates from Config.
+type Monkey struct {
+	cfg Config
+}
+
+// New returns a Monkey configured by cfg.
+func New(cfg Config) *Monkey {
+	return &Monkey{cfg: cfg}
+}
+
+// LinkSpeed implements ChaosMonkey.
+func (m *Monkey) LinkSpeed() *int {
+	if m.cfg.LinkSpeedBps <= 0 {
+		return nil
+	}
+	speed := m.cfg.LinkSpeedBps
+	return &speed
+}
+
+// AllowCommand implements ChaosMonkey.
+func (m *Monkey) AllowCommand(cmd string) bool {
+	return rand.Float64() >= m.cfg.DropRate
+}
+
+// Disconnect implements ChaosMonkey.
+func (m *Monkey) Disconnect() bool {
+	return rand.Float64() < m.cfg.DisconnectRate
+}
@@ -0,0 +1,51 @@
+package chaos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestRateLimitedWriterPaces verifies that a 1 KB/s cap actually paces
+// writes instead of letting them through immediately.
+func TestRateLimitedWriterPaces(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRateLimitedWriter(&buf, 1024)
+
+	payload := make([]byte, 2048)
+
+	start := time.Now()
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// At 1 KB/s, writing 2 KB should take at least ~1 second.
+	if elapsed < 900*time.Millisecond {
+		t.Fatalf("expected write of 2KB at 1KB/s to take at least ~1s, took %v", elapsed)
+	}
+}
+
+// TestMonkeyDisconnectAlways verifies that a 100% disconnect rate always
+// reports the connection should be severed.
+func TestMonkeyDisconnectAlways(t *testing.T) {
+	m := New(Config{DisconnectRate: 1})
+
+	for i := 0; i < 10; i++ {
+		if !m.Disconnect() {
+			t.Fatal("expected Disconnect to always return true at a 100% disconnect rate")
+		}
+	}
+}
+
+// TestMonkeyAllowCommandNeverDrops verifies that a 0% drop rate never
+// refuses a command.
+func TestMonkeyAllowCommandNeverDrops(t *testing.T) {
+	m := New(Config{DropRate: 0})
+
+	for i := 0; i < 10; i++ {
+		if !m.AllowCommand("GET") {
+			t.Fatal("expected AllowCommand to always return true at a 0% drop rate")
+		}
+	}
+}
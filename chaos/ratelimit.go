@@ -0,0 +1,105 @@
+package chaos
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// tokenBucket paces throughput to a fixed bytes/sec rate, refilling over
+// wall-clock time and blocking callers until at least one token is
+// available.
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	last     time.Time
+	lock     sync.Mutex
+}
+
+func newTokenBucket(bytesPerSec int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(bytesPerSec),
+		tokens:   float64(bytesPerSec),
+		last:     time.Now(),
+	}
+}
+
+// refill adds tokens for the time elapsed since the last refill. Callers
+// must hold b.lock.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.capacity
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// take blocks until at least one token is available, then removes and
+// returns up to want tokens.
+func (b *tokenBucket) take(want int) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill()
+	for b.tokens < 1 {
+		b.lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		b.lock.Lock()
+		b.refill()
+	}
+
+	n := want
+	if float64(n) > b.tokens {
+		n = int(b.tokens)
+	}
+	if n < 1 {
+		n = 1
+	}
+	b.tokens -= float64(n)
+	return n
+}
+
+// RateLimitedReader wraps an io.Reader, capping its throughput at
+// bytesPerSec via a token bucket.
+type RateLimitedReader struct {
+	r      io.Reader
+	bucket *tokenBucket
+}
+
+// NewRateLimitedReader returns r wrapped with a bytesPerSec throughput cap.
+func NewRateLimitedReader(r io.Reader, bytesPerSec int) *RateLimitedReader {
+	return &RateLimitedReader{r: r, bucket: newTokenBucket(bytesPerSec)}
+}
+
+// Read implements io.Reader, pacing reads to the configured rate.
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	n := r.bucket.take(len(p))
+	return r.r.Read(p[:n])
+}
+
+// RateLimitedWriter wraps an io.Writer, capping its throughput at
+// bytesPerSec via a token bucket.
+type RateLimitedWriter struct {
+	w      io.Writer
+	bucket *tokenBucket
+}
+
+// NewRateLimitedWriter returns w wrapped with a bytesPerSec throughput cap.
+func NewRateLimitedWriter(w io.Writer, bytesPerSec int) *RateLimitedWriter {
+	return &RateLimitedWriter{w: w, bucket: newTokenBucket(bytesPerSec)}
+}
+
+// Write implements io.Writer, pacing writes to the configured rate.
+func (w *RateLimitedWriter) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		n := w.bucket.take(len(p) - total)
+		written, err := w.w.Write(p[total : total+n])
+		total += written
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -2,14 +2,18 @@ package main
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	chaos "github.com/venky1306/LogDB/chaos"
 	diskstore "github.com/venky1306/LogDB/disk_store"
 	LsmTree "github.com/venky1306/LogDB/log_structured_merge_tree"
 	wal "github.com/venky1306/LogDB/wal"
@@ -19,14 +23,120 @@ const DEFAULT_TCP_PORT = "8080"
 const DEFAULT_UDP_PORT = "1053"
 const DEFAULT_UDP_BUFFER_SIZE = 1024
 const DEFAULT_HOST = "localhost"
+const DEFAULT_MEMCACHED_PORT = "11211"
+const DEFAULT_TCP_READ_TIMEOUT = 30 * time.Second
+const DEFAULT_TCP_IDLE_TIMEOUT = 5 * time.Minute
+
+// Memcached binary protocol constants (see the couchbase/gomemcached wire format).
+const (
+	memcachedMagicRequest  byte = 0x80
+	memcachedMagicResponse byte = 0x81
+
+	memcachedOpGet    byte = 0x00
+	memcachedOpSet    byte = 0x01
+	memcachedOpDelete byte = 0x04
+
+	memcachedStatusSuccess     uint16 = 0x0000
+	memcachedStatusKeyNotFound uint16 = 0x0001
+	memcachedStatusInternalErr uint16 = 0x0084
+
+	memcachedHeaderLen = 24
+
+	// maxMemcachedBodyLength caps the body a single request may declare, so
+	// a forged TotalBodyLength can't force an arbitrarily large allocation.
+	maxMemcachedBodyLength = 1 << 20 // 1 MiB
+)
+
+// timeoutConn wraps a net.Conn so that every read of the underlying
+// connection is bounded by readTimeout, and closes the underlying connection
+// once consecutive timeouts add up to idleTimeout. This keeps a stalled or
+// malicious client from pinning a goroutine and file descriptor forever.
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	idleTimeout  time.Duration
+	timeoutTotal time.Duration
+}
+
+// newTimeoutConn returns conn wrapped with the given read/idle timeouts. A
+// zero readTimeout disables the wrapper and returns conn unchanged.
+func newTimeoutConn(conn net.Conn, readTimeout, idleTimeout time.Duration) net.Conn {
+	if readTimeout == 0 {
+		return conn
+	}
+	return &timeoutConn{Conn: conn, readTimeout: readTimeout, idleTimeout: idleTimeout}
+}
+
+// Read sets a fresh read deadline before each read of the underlying
+// connection and retries after a timeout, so callers only see a timeout
+// error once repeated timeouts reach idleTimeout and the connection has been
+// closed.
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	for {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+
+		n, err := c.Conn.Read(b)
+		if err == nil {
+			c.timeoutTotal = 0
+			return n, nil
+		}
+
+		netErr, ok := err.(net.Error)
+		if !ok || !netErr.Timeout() || n > 0 {
+			return n, err
+		}
+
+		c.timeoutTotal += c.readTimeout
+		if c.timeoutTotal >= c.idleTimeout {
+			c.Conn.Close()
+			return n, err
+		}
+	}
+}
+
+// chaosConn wraps a net.Conn with chaos-monkey rate limiting on both the
+// read and write paths.
+type chaosConn struct {
+	net.Conn
+	reader *chaos.RateLimitedReader
+	writer *chaos.RateLimitedWriter
+}
+
+// newChaosConn wraps conn with monkey's configured link speed. If monkey
+// reports an unthrottled link, conn is returned unchanged.
+func newChaosConn(conn net.Conn, monkey chaos.ChaosMonkey) net.Conn {
+	speed := monkey.LinkSpeed()
+	if speed == nil {
+		return conn
+	}
+	return &chaosConn{
+		Conn:   conn,
+		reader: chaos.NewRateLimitedReader(conn, *speed),
+		writer: chaos.NewRateLimitedWriter(conn, *speed),
+	}
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *chaosConn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
 
 // Server represents a server instance.
 type Server struct {
-	Port          string    // Port for TCP connections
-	Host          string    // Host address
-	DBEngine      *DBEngine // Database engine
-	UDPPort       string    // Port for UDP connections
-	UDPBufferSize int       // Buffer size for UDP packets
+	Port          string            // Port for TCP connections
+	Host          string            // Host address
+	DBEngine      *DBEngine         // Database engine
+	UDPPort       string            // Port for UDP connections
+	UDPBufferSize int               // Buffer size for UDP packets
+	MemcachedPort string            // Port for memcached binary-protocol connections
+	ReadTimeout   time.Duration     // Per-read deadline applied to accepted connections
+	IdleTimeout   time.Duration     // How long a connection may keep timing out before it's closed
+	Chaos         chaos.ChaosMonkey // Optional fault-injection hook for accepted connections; nil when disabled
 }
 
 func NewServer(config ServerConfig) (*Server, error) {
@@ -49,17 +159,31 @@ func NewServer(config ServerConfig) (*Server, error) {
 	store := diskstore.New(diskStoreOpts)
 
 	// Open or create the WAL file
-	wal, err := wal.OpenOrCreateWAL(config.DBEngineConfig.WalPath)
+	wal, err := wal.OpenOrCreateWAL(config.DBEngineConfig.WalPath, config.DBEngineConfig.MaxSegmentBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open or create WAL: %v", err)
 	}
 
+	// Build the chaos monkey, if fault injection is enabled
+	var chaosMonkey chaos.ChaosMonkey
+	if config.Chaos.Enabled {
+		chaosMonkey = chaos.New(chaos.Config{
+			LinkSpeedBps:   config.Chaos.LinkSpeedBps,
+			DropRate:       config.Chaos.DropRate,
+			DisconnectRate: config.Chaos.DisconnectRate,
+		})
+	}
+
 	// Create a new server instance
 	return &Server{
 		Port:          config.Port,
 		Host:          config.Host,
 		UDPPort:       config.UDPPort,
 		UDPBufferSize: config.UDPBufferSize,
+		MemcachedPort: config.MemcachedPort,
+		ReadTimeout:   config.TCPReadTimeout.Duration,
+		IdleTimeout:   config.TCPIdleTimeout.Duration,
+		Chaos:         chaosMonkey,
 		DBEngine: &DBEngine{
 			LsmTree: lsmTree,
 			Wal:     wal,
@@ -86,6 +210,14 @@ func (s *Server) Start() error {
 	}
 	defer udpServer.Close()
 
+	// Start memcached binary-protocol listener
+	memcachedListener, err := net.Listen("tcp", fmt.Sprintf("%s:%s", s.Host, s.MemcachedPort))
+	if err != nil {
+		fmt.Println("Error listening (memcached):", err)
+		return err
+	}
+	defer memcachedListener.Close()
+
 	// Signals for data loading and persisting cycle
 	dataLoadSignal := make(chan bool, 1)
 	startPersistingCycleSignal := make(chan bool, 1)
@@ -106,7 +238,11 @@ func (s *Server) Start() error {
 	// Wait for data loading to complete
 	<-dataLoadSignal
 
-	// Start persisting cycle
+	// Start persisting cycle. WAL.Truncate() still works (it now forwards
+	// to Checkpoint using the highest LSN written), but disk_store.PersistToDisk
+	// should migrate to calling s.DBEngine.Wal.Checkpoint(lsn) directly with
+	// the LSN its flush actually covered, rather than relying on the
+	// deprecated alias.
 	go s.DBEngine.Store.PersistToDisk(s.DBEngine.Wal, startPersistingCycleSignal)
 
 	// Handle shutdown signals
@@ -130,7 +266,11 @@ func (s *Server) Start() error {
 				fmt.Println("Error accepting (TCP):", err)
 				continue
 			}
-			go handleConnection(conn, s.DBEngine.LsmTree, s.DBEngine.Wal)
+			conn = newTimeoutConn(conn, s.ReadTimeout, s.IdleTimeout)
+			if s.Chaos != nil {
+				conn = newChaosConn(conn, s.Chaos)
+			}
+			go handleConnection(conn, s.DBEngine.LsmTree, s.DBEngine.Wal, s.Chaos)
 		}
 	}()
 
@@ -147,12 +287,29 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	// Goroutine to handle memcached binary-protocol connections
+	go func() {
+		for {
+			conn, err := memcachedListener.Accept()
+			if err != nil {
+				fmt.Println("Error accepting (memcached):", err)
+				continue
+			}
+			conn = newTimeoutConn(conn, s.ReadTimeout, s.IdleTimeout)
+			if s.Chaos != nil {
+				conn = newChaosConn(conn, s.Chaos)
+			}
+			go handleMemcachedConnection(conn, s.DBEngine.LsmTree, s.DBEngine.Wal, s.Chaos)
+		}
+	}()
+
 	// Keep the main goroutine alive until a kill signal is received
 	select {}
 }
 
 // handleConnection handles incoming connections and processes commands.
-func handleConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL) {
+// monkey may be nil, in which case fault injection is disabled.
+func handleConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL, monkey chaos.ChaosMonkey) {
 	defer conn.Close()
 
 	scanner := bufio.NewScanner(conn)
@@ -171,6 +328,17 @@ func handleConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL) {
 			continue
 		}
 
+		if monkey != nil {
+			if monkey.Disconnect() {
+				return
+			}
+			if !monkey.AllowCommand(cmd[0]) {
+				fmt.Fprintln(writer, "Error: command dropped by chaos monkey")
+				writer.Flush()
+				continue
+			}
+		}
+
 		switch cmd[0] {
 		case "PUT":
 			if len(cmd) != 3 {
@@ -181,7 +349,7 @@ func handleConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL) {
 			}
 
 			// Write to WAL
-			if err := wal.Write([]byte("+"), []byte(cmd[1]), []byte(cmd[2])); err != nil {
+			if _, err := wal.Write([]byte("+"), []byte(cmd[1]), []byte(cmd[2])); err != nil {
 				fmt.Fprintln(writer, "Error writing to WAL:", err)
 				writer.Flush()
 				continue
@@ -216,7 +384,7 @@ func handleConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL) {
 			}
 
 			// Write to WAL
-			if err := wal.Write([]byte("-"), []byte(cmd[1])); err != nil {
+			if _, err := wal.Write([]byte("-"), []byte(cmd[1])); err != nil {
 				fmt.Fprintln(writer, "Error writing to WAL:", err)
 				writer.Flush()
 				continue
@@ -274,7 +442,7 @@ func handleUDPPacket(udpConn net.PacketConn, packet []byte, addr net.Addr, ltree
 			}
 
 			// Write to WAL
-			if err := wal.Write([]byte("+"), []byte(cmd[1]), []byte(cmd[2])); err != nil {
+			if _, err := wal.Write([]byte("+"), []byte(cmd[1]), []byte(cmd[2])); err != nil {
 				response = "Error writing to WAL: " + err.Error()
 				break
 			}
@@ -289,7 +457,7 @@ func handleUDPPacket(udpConn net.PacketConn, packet []byte, addr net.Addr, ltree
 			}
 
 			// Write to WAL
-			if err := wal.Write([]byte("-"), []byte(cmd[1])); err != nil {
+			if _, err := wal.Write([]byte("-"), []byte(cmd[1])); err != nil {
 				response = "Error writing to WAL: " + err.Error()
 				break
 			}
@@ -311,3 +479,204 @@ func handleUDPPacket(udpConn net.PacketConn, packet []byte, addr net.Addr, ltree
 		fmt.Println("Error sending UDP response:", err)
 	}
 }
+
+// memcachedHeader is the 24-byte header shared by memcached binary protocol
+// requests and responses.
+type memcachedHeader struct {
+	Magic           byte
+	Opcode          byte
+	KeyLength       uint16
+	ExtrasLength    byte
+	DataType        byte
+	VbucketOrStatus uint16
+	TotalBodyLength uint32
+	Opaque          uint32
+	CAS             uint64
+}
+
+// parseMemcachedHeader decodes a 24-byte memcached binary protocol header.
+func parseMemcachedHeader(buf []byte) memcachedHeader {
+	return memcachedHeader{
+		Magic:           buf[0],
+		Opcode:          buf[1],
+		KeyLength:       binary.BigEndian.Uint16(buf[2:4]),
+		ExtrasLength:    buf[4],
+		DataType:        buf[5],
+		VbucketOrStatus: binary.BigEndian.Uint16(buf[6:8]),
+		TotalBodyLength: binary.BigEndian.Uint32(buf[8:12]),
+		Opaque:          binary.BigEndian.Uint32(buf[12:16]),
+		CAS:             binary.BigEndian.Uint64(buf[16:24]),
+	}
+}
+
+// writeMemcachedResponse writes a 24-byte memcached binary protocol response
+// header followed by extras (if any) and value.
+func writeMemcachedResponse(writer *bufio.Writer, opcode byte, status uint16, opaque uint32, cas uint64, extras, value []byte) error {
+	header := make([]byte, memcachedHeaderLen)
+	header[0] = memcachedMagicResponse
+	header[1] = opcode
+	header[4] = byte(len(extras))
+	// KeyLength and DataType are left at zero: responses in this handler
+	// never echo the key back to the client.
+	binary.BigEndian.PutUint16(header[6:8], status)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(extras)+len(value)))
+	binary.BigEndian.PutUint32(header[12:16], opaque)
+	binary.BigEndian.PutUint64(header[16:24], cas)
+
+	if _, err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write memcached response header: %v", err)
+	}
+	if len(extras) > 0 {
+		if _, err := writer.Write(extras); err != nil {
+			return fmt.Errorf("failed to write memcached response extras: %v", err)
+		}
+	}
+	if len(value) > 0 {
+		if _, err := writer.Write(value); err != nil {
+			return fmt.Errorf("failed to write memcached response value: %v", err)
+		}
+	}
+	return writer.Flush()
+}
+
+// encodeStoredValue packs a SET's extras alongside its value into the single
+// string the LSM tree and WAL store, so a later GET can recover the
+// original value byte-for-byte instead of returning extras+value as one
+// blob. The memcached protocol already caps ExtrasLength at a single byte,
+// so a one-byte length prefix is sufficient.
+func encodeStoredValue(extras, value []byte) []byte {
+	stored := make([]byte, 0, 1+len(extras)+len(value))
+	stored = append(stored, byte(len(extras)))
+	stored = append(stored, extras...)
+	stored = append(stored, value...)
+	return stored
+}
+
+// decodeStoredValue reverses encodeStoredValue, splitting stored back into
+// the extras and value a SET originally carried. ok is false if stored is
+// too short to contain the length it declares, which should only happen if
+// the underlying data was corrupted.
+func decodeStoredValue(stored []byte) (extras, value []byte, ok bool) {
+	if len(stored) < 1 {
+		return nil, nil, false
+	}
+	extrasLen := int(stored[0])
+	if 1+extrasLen > len(stored) {
+		return nil, nil, false
+	}
+	return stored[1 : 1+extrasLen], stored[1+extrasLen:], true
+}
+
+// handleMemcachedConnection handles a connection speaking the memcached
+// binary protocol, decoding GET/SET/DELETE requests into calls on the LSM
+// tree and WAL. monkey may be nil, in which case fault injection is
+// disabled.
+func handleMemcachedConnection(conn net.Conn, ltree *LsmTree.LSMTree, wal *wal.WAL, monkey chaos.ChaosMonkey) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	headerBuf := make([]byte, memcachedHeaderLen)
+
+	for {
+		if _, err := io.ReadFull(reader, headerBuf); err != nil {
+			return
+		}
+
+		header := parseMemcachedHeader(headerBuf)
+		if header.Magic != memcachedMagicRequest {
+			// Not a request we understand; drop the connection rather than
+			// try to resynchronize on the byte stream.
+			return
+		}
+
+		// The header is fully attacker-controlled, so validate its lengths
+		// before trusting them for an allocation or a slice bound: a forged
+		// TotalBodyLength could otherwise exhaust memory, and an
+		// ExtrasLength/KeyLength pair that overruns TotalBodyLength would
+		// panic on the slice expressions below.
+		if header.TotalBodyLength > maxMemcachedBodyLength {
+			return
+		}
+		if uint32(header.ExtrasLength)+uint32(header.KeyLength) > header.TotalBodyLength {
+			return
+		}
+
+		body := make([]byte, header.TotalBodyLength)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		if monkey != nil {
+			if monkey.Disconnect() {
+				return
+			}
+			if !monkey.AllowCommand(fmt.Sprintf("%#02x", header.Opcode)) {
+				if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusKeyNotFound, header.Opaque, header.CAS, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		extras := body[:header.ExtrasLength]
+		key := body[header.ExtrasLength : uint32(header.ExtrasLength)+uint32(header.KeyLength)]
+		value := body[uint32(header.ExtrasLength)+uint32(header.KeyLength):]
+
+		switch header.Opcode {
+		case memcachedOpGet:
+			stored, exist := ltree.Get(string(key))
+			if !exist {
+				if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusKeyNotFound, header.Opaque, header.CAS, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+			storedExtras, storedVal, ok := decodeStoredValue([]byte(stored))
+			if !ok {
+				if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusInternalErr, header.Opaque, header.CAS, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+			if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusSuccess, header.Opaque, header.CAS, storedExtras, storedVal); err != nil {
+				return
+			}
+		case memcachedOpSet:
+			// Extras (flags/expiration) aren't modeled by the LSM tree yet,
+			// so they're packed alongside the value with a length prefix
+			// rather than appended to it, which would otherwise corrupt the
+			// value a later GET returns.
+			storedValue := encodeStoredValue(extras, value)
+
+			if _, err := wal.Write([]byte("+"), key, storedValue); err != nil {
+				if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusInternalErr, header.Opaque, header.CAS, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+
+			ltree.Put(string(key), string(storedValue))
+			if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusSuccess, header.Opaque, header.CAS, nil, nil); err != nil {
+				return
+			}
+		case memcachedOpDelete:
+			if _, err := wal.Write([]byte("-"), key); err != nil {
+				if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusInternalErr, header.Opaque, header.CAS, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+
+			ltree.Del(string(key))
+			if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusSuccess, header.Opaque, header.CAS, nil, nil); err != nil {
+				return
+			}
+		default:
+			if err := writeMemcachedResponse(writer, header.Opcode, memcachedStatusKeyNotFound, header.Opaque, header.CAS, nil, nil); err != nil {
+				return
+			}
+		}
+	}
+}
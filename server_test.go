@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	chaos "github.com/venky1306/LogDB/chaos"
+	LsmTree "github.com/venky1306/LogDB/log_structured_merge_tree"
+	wal "github.com/venky1306/LogDB/wal"
+)
+
+// TestTimeoutConnClosesOnIdle verifies that a connection wrapped by
+// newTimeoutConn is closed once repeated read timeouts add up to the
+// configured idle timeout, without anything ever being written to it.
+func TestTimeoutConnClosesOnIdle(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	wrapped := newTimeoutConn(server, 10*time.Millisecond, 50*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := wrapped.Read(buf); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		// The read loop exited because the connection timed out and was
+		// closed, which is the behavior under test.
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeoutConn did not close an idle connection in time")
+	}
+
+	// Further writes from the peer should now fail since the server side
+	// has been closed.
+	client.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Fatal("expected write to closed connection to fail")
+	}
+}
+
+// TestNewTimeoutConnDisabled verifies that a zero read timeout leaves the
+// connection unwrapped.
+func TestNewTimeoutConnDisabled(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	wrapped := newTimeoutConn(server, 0, 0)
+	if wrapped != server {
+		t.Fatal("expected newTimeoutConn to return the connection unchanged when readTimeout is zero")
+	}
+}
+
+// TestHandleConnectionDisconnectsOnChaos verifies that a 100% disconnect
+// rate closes the socket before the first response is sent.
+func TestHandleConnectionDisconnectsOnChaos(t *testing.T) {
+	w, err := wal.OpenOrCreateWAL(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	ltree := LsmTree.New(LsmTree.LSMTreeOpts{})
+	monkey := chaos.New(chaos.Config{DisconnectRate: 1})
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		handleConnection(server, ltree, w, monkey)
+		close(done)
+	}()
+
+	client.SetWriteDeadline(time.Now().Add(time.Second))
+	fmt.Fprintln(client, "GET foo")
+
+	select {
+	case <-done:
+		// handleConnection returned (and closed the connection) without
+		// ever writing a response, which is the behavior under test.
+	case <-time.After(time.Second):
+		t.Fatal("expected handleConnection to disconnect before responding")
+	}
+}
@@ -2,9 +2,14 @@ package wal
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -13,237 +18,537 @@ import (
 
 // Entry represents a single entry in the WAL.
 type Entry struct {
+	LSN    uint64 `json:"lsn"`
 	Key    string `json:"k"`
 	Value  string `json:"v"`
 	Delete bool   `json:"-"`
 }
 
-// DefaultWALPath is the default path for the WAL file.
-const DEFAULT_WAL_PATH = "wal.aof"
+// DEFAULT_WAL_PATH is the default directory holding WAL segments and the
+// checkpoint manifest.
+const DEFAULT_WAL_PATH = "wal_segments"
+
+// DEFAULT_MAX_SEGMENT_BYTES is the default size at which the active segment
+// is rotated to a new one.
+const DEFAULT_MAX_SEGMENT_BYTES int64 = 64 * 1024 * 1024
+
+const segmentPrefix = "wal-"
+const segmentSuffix = ".aof"
+const manifestFilename = "wal.manifest"
+
+// legacyWALFile is the single-file WAL path this package used before the
+// segmented rewrite (it was also the old DEFAULT_WAL_PATH). OpenOrCreateWAL
+// refuses to start if it finds one, rather than silently leaving whatever
+// it was never flushed behind in a format this package can no longer read.
+const legacyWALFile = "wal.aof"
+
+// crc32cTable is used to checksum every record so a torn write left by a
+// crash mid-append can be detected instead of silently replayed as garbage.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// segmentMeta describes a sealed (no longer written to) segment.
+type segmentMeta struct {
+	seq        uint64
+	maxLSN     uint64
+	hasEntries bool
+}
 
-// WAL represents the Write-Ahead Log.
+// WAL represents a segmented, checkpointed Write-Ahead Log. Writes land in
+// an active segment file that rotates to a new one once it would grow past
+// maxSegmentBytes. Checkpoint records the highest LSN that's been safely
+// persisted elsewhere (an SSTable flush) so fully-covered segments can be
+// deleted instead of replayed.
 type WAL struct {
-	filepath string
-	file     *os.File
-	writer   *bufio.Writer
-	lock     sync.Mutex
+	dir             string
+	maxSegmentBytes int64
+
+	activeSeq    uint64
+	activeFile   *os.File
+	activeWriter *bufio.Writer
+	activeSize   int64
+	activeMaxLSN uint64
+
+	sealed []segmentMeta // ascending seq order
+
+	nextSeq       uint64
+	nextLSN       uint64
+	checkpointLSN uint64
+	hasCheckpoint bool // distinguishes "checkpointed at LSN 0" from "never checkpointed"
+
+	lock sync.Mutex
+}
+
+// segmentPath returns the path of the segment file with the given sequence
+// number inside dir.
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%010d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+// manifestPath returns the path of the checkpoint manifest inside dir.
+func manifestPath(dir string) string {
+	return filepath.Join(dir, manifestFilename)
 }
 
-// OpenOrCreateWAL opens an existing WAL file or creates a new one if it doesn't exist.
-func OpenOrCreateWAL(path string) (*WAL, error) {
-	var file *os.File
+// listSegmentSeqs returns the sequence numbers of every segment file present
+// in dir, sorted ascending.
+func listSegmentSeqs(dir string) ([]uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if the WAL file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		// If it doesn't exist, create a new file
-		file, err = os.Create(path)
+	seqs := make([]uint64, 0, len(matches))
+	for _, match := range matches {
+		name := filepath.Base(match)
+		seqStr := strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix)
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create WAL file: %v", err)
+			continue // Not one of ours; ignore.
 		}
-	} else {
-		// If it exists, open the file in append mode
-		file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open WAL file: %v", err)
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// readManifest returns the checkpoint LSN recorded in dir's manifest. ok is
+// false if no manifest has been written yet, which must be distinguished
+// from a manifest that legitimately records a checkpoint at LSN 0: LSN 0 is
+// itself a valid record, so "nothing checkpointed yet" can't be represented
+// by the LSN value alone.
+func readManifest(dir string) (lsn uint64, ok bool, err error) {
+	data, err := os.ReadFile(manifestPath(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
 		}
+		return 0, false, err
 	}
 
-	// Create a buffered writer for efficient writing
-	writer := bufio.NewWriter(file)
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return 0, false, nil
+	}
 
-	// Initialize and return the WAL instance
-	return &WAL{
-		filepath: path,
-		file:     file,
-		writer:   writer,
-		lock:     sync.Mutex{},
-	}, nil
+	lsn, err = strconv.ParseUint(trimmed, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("malformed manifest: %v", err)
+	}
+	return lsn, true, nil
 }
 
-// Write appends data to the Write-Ahead Log (WAL) buffer and flushes if necessary.
-func (w *WAL) Write(data ...[]byte) error {
-	// Lock the WAL to ensure exclusive access
-	w.lock.Lock()
-	defer w.lock.Unlock()
+// writeManifest atomically records lsn as the checkpoint in dir's manifest.
+func writeManifest(dir string, lsn uint64) error {
+	tmp := manifestPath(dir) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(lsn, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, manifestPath(dir))
+}
 
-	// If the size of incoming data is more than the available buffer size,
-	// flush the buffer to the file to prevent overflow
-	if len(data) > w.writer.Available() {
-		if err := w.flushBuffer(); err != nil {
-			return fmt.Errorf("failed to flush buffer: %v", err)
-		}
+// recordHeaderLen is the fixed-size prefix of every record: a 4-byte
+// payload length followed by a 4-byte CRC32C of that payload.
+const recordHeaderLen = 8
+
+// encodeRecord serializes data as a single WAL record. Every field is
+// length-prefixed rather than delimited, so a key or value containing
+// arbitrary bytes (including '\n' or any other byte a text-based framing
+// might use as a separator) round-trips exactly. The record is itself
+// prefixed with its payload length and a CRC32C of that payload, so a torn
+// or corrupt tail can be detected on replay without scanning for a
+// terminator.
+func encodeRecord(lsn uint64, data [][]byte) []byte {
+	payload := make([]byte, 8, 8+len(data)*4)
+	binary.BigEndian.PutUint64(payload[:8], lsn)
+
+	payload = append(payload, byte(len(data)))
+	for _, d := range data {
+		fieldLen := make([]byte, 4)
+		binary.BigEndian.PutUint32(fieldLen, uint32(len(d)))
+		payload = append(payload, fieldLen...)
+		payload = append(payload, d...)
 	}
 
-	// Delimiter to separate entries
-	delimiter := []byte("|")
+	crc := crc32.Checksum(payload, crc32cTable)
 
-	// Write each data entry to the buffer
-	for _, d := range data {
-		// Append delimiter to separate entries
-		d = append(d, delimiter...)
-		// Write data to the buffer
-		_, err := w.writer.Write(d)
-		if err != nil {
-			return fmt.Errorf("failed to write to buffer: %v", err)
+	record := make([]byte, recordHeaderLen, recordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc)
+	record = append(record, payload...)
+	return record
+}
+
+// decodeRecordPayload parses a record's payload (the bytes after its
+// length+CRC header) into its LSN, operation and fields. ok is false if the
+// payload is malformed, which readSegmentRecords treats the same as a torn
+// or corrupt record.
+func decodeRecordPayload(payload []byte) (lsn uint64, op string, fields [][]byte, ok bool) {
+	if len(payload) < 9 {
+		return 0, "", nil, false
+	}
+	lsn = binary.BigEndian.Uint64(payload[0:8])
+
+	count := int(payload[8])
+	offset := 9
+	fields = make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if offset+4 > len(payload) {
+			return 0, "", nil, false
+		}
+		fieldLen := int(binary.BigEndian.Uint32(payload[offset : offset+4]))
+		offset += 4
+		if fieldLen < 0 || offset+fieldLen > len(payload) {
+			return 0, "", nil, false
+		}
+		fields = append(fields, payload[offset:offset+fieldLen])
+		offset += fieldLen
+	}
+	if offset != len(payload) {
+		return 0, "", nil, false
+	}
+	if count == 0 {
+		return lsn, "", nil, true
+	}
+	return lsn, string(fields[0]), fields[1:], true
+}
+
+// readSegmentRecords reads every complete, checksum-valid record from the
+// segment file at path, in order. validEnd is the byte offset immediately
+// after the last such record; a caller that reopens the file for appending
+// should truncate to validEnd to drop a torn or corrupt tail left by a
+// crash mid-write.
+func readSegmentRecords(path string) (entries []Entry, validEnd int64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
 		}
+		return nil, 0, err
 	}
 
-	// Write end byte to indicate the end of the entry
-	if _, err := w.writer.WriteString("\n"); err != nil {
-		return fmt.Errorf("failed to write end byte to buffer: %v", err)
+	var offset int64
+	for offset+recordHeaderLen <= int64(len(data)) {
+		payloadLen := binary.BigEndian.Uint32(data[offset : offset+4])
+		crcWant := binary.BigEndian.Uint32(data[offset+4 : offset+recordHeaderLen])
+
+		recordEnd := offset + recordHeaderLen + int64(payloadLen)
+		if recordEnd > int64(len(data)) {
+			// The record's declared length runs past what's on disk; a
+			// torn write. Stop before it rather than replay garbage.
+			break
+		}
+
+		payload := data[offset+recordHeaderLen : recordEnd]
+		if crc32.Checksum(payload, crc32cTable) != crcWant {
+			// Treat a corrupt record the same as a torn tail.
+			break
+		}
+
+		lsn, op, fields, ok := decodeRecordPayload(payload)
+		if !ok {
+			break
+		}
+
+		offset = recordEnd
+
+		switch op {
+		case "+":
+			if len(fields) != 2 {
+				continue // Malformed field count; skip but keep replaying.
+			}
+			entries = append(entries, Entry{LSN: lsn, Key: string(fields[0]), Value: string(fields[1]), Delete: false})
+		case "-":
+			if len(fields) != 1 {
+				continue
+			}
+			entries = append(entries, Entry{LSN: lsn, Key: string(fields[0]), Delete: true})
+		}
 	}
 
-	return nil
+	return entries, offset, nil
 }
 
-// flushBuffer flushes the buffer to the file.
-func (w *WAL) flushBuffer() error {
-	if err := w.writer.Flush(); err != nil {
-		return fmt.Errorf("failed to flush buffer to file: %v", err)
+// highestLSN returns the largest LSN among entries and whether entries was
+// non-empty.
+func highestLSN(entries []Entry) (uint64, bool) {
+	if len(entries) == 0 {
+		return 0, false
 	}
-	return nil
+	max := entries[0].LSN
+	for _, e := range entries[1:] {
+		if e.LSN > max {
+			max = e.LSN
+		}
+	}
+	return max, true
 }
 
-// Persist flushes the buffer to the file and syncs the file to ensure data durability.
-func (w *WAL) Persist() error {
-	// Lock the WAL to ensure exclusive access
-	w.lock.Lock()
-	defer w.lock.Unlock()
+// OpenOrCreateWAL opens the segmented WAL rooted at dir, creating it if it
+// doesn't exist yet. maxSegmentBytes caps the size of the active segment
+// before Write rolls to a new one; a value of 0 uses
+// DEFAULT_MAX_SEGMENT_BYTES.
+func OpenOrCreateWAL(dir string, maxSegmentBytes int64) (*WAL, error) {
+	if maxSegmentBytes <= 0 {
+		maxSegmentBytes = DEFAULT_MAX_SEGMENT_BYTES
+	}
 
-	// Flush the buffer to write any pending data to the file
-	if err := w.writer.Flush(); err != nil {
-		return fmt.Errorf("failed to flush buffer: %v", err)
+	if info, err := os.Stat(legacyWALFile); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("found a pre-upgrade single-file WAL at %q: this version replays a segmented WAL directory and cannot read the old format, so it won't start until that file is migrated or removed", legacyWALFile)
 	}
 
-	// Sync the file to ensure data durability
-	if err := w.file.Sync(); err != nil {
-		return fmt.Errorf("failed to sync file: %v", err)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %v", err)
+	}
+
+	checkpointLSN, hasCheckpoint, err := readManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL manifest: %v", err)
 	}
 
-	// Clear the write buffer for the next write operation
-	w.writer.Reset(w.file)
+	seqs, err := listSegmentSeqs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WAL segments: %v", err)
+	}
+	if len(seqs) == 0 {
+		seqs = []uint64{0}
+	}
 
-	return nil
+	w := &WAL{dir: dir, maxSegmentBytes: maxSegmentBytes, checkpointLSN: checkpointLSN, hasCheckpoint: hasCheckpoint}
+
+	activeSeq := seqs[len(seqs)-1]
+	for _, seq := range seqs[:len(seqs)-1] {
+		entries, _, err := readSegmentRecords(segmentPath(dir, seq))
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect WAL segment %d: %v", seq, err)
+		}
+		max, has := highestLSN(entries)
+		w.sealed = append(w.sealed, segmentMeta{seq: seq, maxLSN: max, hasEntries: has})
+		if has && max+1 > w.nextLSN {
+			w.nextLSN = max + 1
+		}
+	}
+
+	activeEntries, validEnd, err := readSegmentRecords(segmentPath(dir, activeSeq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect active WAL segment: %v", err)
+	}
+	if max, has := highestLSN(activeEntries); has {
+		w.activeMaxLSN = max
+		if max+1 > w.nextLSN {
+			w.nextLSN = max + 1
+		}
+	}
+
+	file, err := os.OpenFile(segmentPath(dir, activeSeq), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open active WAL segment: %v", err)
+	}
+
+	// Drop any torn tail left by a crash mid-append before we start
+	// appending new records after it.
+	if err := file.Truncate(validEnd); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate torn WAL tail: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek active WAL segment: %v", err)
+	}
+
+	w.activeSeq = activeSeq
+	w.nextSeq = activeSeq + 1
+	w.activeFile = file
+	w.activeWriter = bufio.NewWriter(file)
+	w.activeSize = validEnd
+
+	return w, nil
 }
 
-// ReadEntries reads entries from the WAL file and returns them as a slice of Entry.
-func (w *WAL) ReadEntries() []Entry {
-	// Lock the WAL to ensure exclusive access
+// Write appends data as a single record to the active WAL segment,
+// transparently rotating to a new segment first if the record would push
+// the active segment past maxSegmentBytes. It returns the LSN assigned to
+// the record.
+func (w *WAL) Write(data ...[]byte) (uint64, error) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	// Open the WAL file for reading
-	file, err := os.OpenFile(w.filepath, os.O_RDONLY, 0644)
-	if err != nil {
-		panic(fmt.Errorf("failed to open WAL file for reading: %v", err))
+	record := encodeRecord(w.nextLSN, data)
+
+	if w.activeSize > 0 && w.activeSize+int64(len(record)) > w.maxSegmentBytes {
+		if err := w.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate WAL segment: %v", err)
+		}
 	}
-	defer file.Close() // Close the file when done
 
-	// Create a reader for reading from the file
-	reader := bufio.NewReader(file)
+	if _, err := w.activeWriter.Write(record); err != nil {
+		return 0, fmt.Errorf("failed to write to buffer: %v", err)
+	}
 
-	// Read all data from the file
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		panic(fmt.Errorf("failed to read data from WAL file: %v", err))
+	lsn := w.nextLSN
+	w.nextLSN++
+	w.activeSize += int64(len(record))
+	if lsn > w.activeMaxLSN {
+		w.activeMaxLSN = lsn
 	}
 
-	// Split data into individual commands
-	cmds := strings.Split(string(data), "\n")
+	return lsn, nil
+}
 
-	// Initialize slice to store parsed entries
-	entries := make([]Entry, 0, len(cmds))
+// rotate seals the active segment and opens a new, empty one to become the
+// active segment. Callers must hold w.lock.
+func (w *WAL) rotate() error {
+	if err := w.activeWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush active segment before rotation: %v", err)
+	}
+	if err := w.activeFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync active segment before rotation: %v", err)
+	}
+	if err := w.activeFile.Close(); err != nil {
+		return fmt.Errorf("failed to close active segment: %v", err)
+	}
 
-	// Parse each command and create corresponding entry
-	for _, cmd := range cmds {
-		if cmd == "" {
-			continue // Skip empty commands
-		}
+	w.sealed = append(w.sealed, segmentMeta{seq: w.activeSeq, maxLSN: w.activeMaxLSN, hasEntries: w.activeSize > 0})
 
-		args := strings.Split(cmd, "|")
+	seq := w.nextSeq
+	w.nextSeq++
 
-		// Determine command type and create entry accordingly
-		switch args[0] {
-		case "+":
-			if len(args) != 4 {
-				continue // Skip malformed commands
-			}
-			entries = append(entries, Entry{Key: args[1], Value: args[2], Delete: false})
-		case "-":
-			if len(args) != 3 {
-				continue // Skip malformed commands
-			}
-			entries = append(entries, Entry{Key: args[1], Delete: true})
-		}
+	file, err := os.OpenFile(segmentPath(w.dir, seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL segment %d: %v", seq, err)
 	}
 
-	return entries
+	w.activeSeq = seq
+	w.activeFile = file
+	w.activeWriter = bufio.NewWriter(file)
+	w.activeSize = 0
+	w.activeMaxLSN = 0
+
+	return nil
 }
 
-// InitDB initializes the database by replaying WAL entries onto the LSM tree.
-func (w *WAL) InitDB(lsmTree *LsmTree.LSMTree) error {
-	// Lock the WAL to ensure exclusive access
+// Persist flushes the active segment's buffer and syncs it to ensure data
+// durability.
+func (w *WAL) Persist() error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	// Open the WAL file for reading
-	file, err := os.OpenFile(w.filepath, os.O_RDONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open WAL file for reading: %v", err)
+	if err := w.activeWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush buffer: %v", err)
 	}
-	defer file.Close() // Close the file when done
 
-	// Create a reader for reading from the file
-	reader := bufio.NewReader(file)
+	if err := w.activeFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %v", err)
+	}
 
-	// Read all data from the file
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read data from WAL file: %v", err)
+	return nil
+}
+
+// orderedSegmentSeqs returns every segment's sequence number, sealed and
+// active, in ascending order. Callers must hold w.lock.
+func (w *WAL) orderedSegmentSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(w.sealed)+1)
+	for _, seg := range w.sealed {
+		seqs = append(seqs, seg.seq)
 	}
+	seqs = append(seqs, w.activeSeq)
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// ReadEntries reads every entry not yet covered by the checkpoint, from
+// every segment in sequence order.
+func (w *WAL) ReadEntries() ([]Entry, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	// Split data into individual commands
-	cmds := strings.Split(string(data), "\n")
+	if err := w.activeWriter.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush active segment: %v", err)
+	}
 
-	// Replay each command onto the LSM tree
-	for _, cmd := range cmds {
-		if cmd == "" {
-			continue // Skip empty commands
+	var all []Entry
+	for _, seq := range w.orderedSegmentSeqs() {
+		entries, _, err := readSegmentRecords(segmentPath(w.dir, seq))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WAL segment %d: %v", seq, err)
 		}
+		for _, e := range entries {
+			if w.hasCheckpoint && e.LSN <= w.checkpointLSN {
+				continue
+			}
+			all = append(all, e)
+		}
+	}
 
-		args := strings.Split(cmd, "|")
+	return all, nil
+}
 
-		// Determine command type and apply it to the LSM tree
-		switch args[0] {
-		case "+":
-			if len(args) != 4 {
-				continue // Skip malformed commands
-			}
-			lsmTree.Put(args[1], args[2])
-		case "-":
-			if len(args) != 3 {
-				continue // Skip malformed commands
-			}
-			lsmTree.Del(args[1])
+// InitDB initializes the database by replaying every WAL entry not yet
+// covered by the checkpoint onto the LSM tree.
+func (w *WAL) InitDB(lsmTree *LsmTree.LSMTree) error {
+	entries, err := w.ReadEntries()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Delete {
+			lsmTree.Del(entry.Key)
+		} else {
+			lsmTree.Put(entry.Key, entry.Value)
 		}
 	}
 
 	return nil
 }
 
-// Truncate truncates the WAL file, removing all entries.
-func (w *WAL) Truncate() {
-	// Lock the WAL to ensure exclusive access
+// Truncate is a deprecated alias for Checkpoint using the highest LSN
+// written so far. It exists so that a caller still built against the old
+// single-file WAL's Truncate() (there is no value in wiping the whole log
+// after every flush now that segments can be checkpointed individually)
+// keeps working until it migrates to calling Checkpoint directly with the
+// LSN its flush actually covered.
+//
+// Deprecated: call Checkpoint(lsn) with the LSN the flush covered instead.
+func (w *WAL) Truncate() error {
+	w.lock.Lock()
+	nextLSN := w.nextLSN
+	w.lock.Unlock()
+
+	if nextLSN == 0 {
+		return nil
+	}
+	return w.Checkpoint(nextLSN - 1)
+}
+
+// Checkpoint records lsn as the highest LSN safely persisted elsewhere (an
+// SSTable flush), then deletes any sealed segment whose records are fully
+// covered by it. It is a no-op if lsn is behind the current checkpoint.
+func (w *WAL) Checkpoint(lsn uint64) error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	// Truncate the file to remove all entries
-	if err := w.file.Truncate(0); err != nil {
-		fmt.Printf("failed to truncate WAL file: %v\n", err)
+	if w.hasCheckpoint && lsn < w.checkpointLSN {
+		return nil
 	}
 
-	// Move the file pointer to the beginning of the file
-	if _, err := w.file.Seek(0, 0); err != nil {
-		fmt.Printf("failed to seek to beginning of WAL file: %v\n", err)
+	if err := writeManifest(w.dir, lsn); err != nil {
+		return fmt.Errorf("failed to write WAL manifest: %v", err)
+	}
+	w.checkpointLSN = lsn
+	w.hasCheckpoint = true
+
+	remaining := w.sealed[:0:0]
+	for _, seg := range w.sealed {
+		if seg.hasEntries && seg.maxLSN > lsn {
+			remaining = append(remaining, seg)
+			continue
+		}
+		if err := os.Remove(segmentPath(w.dir, seg.seq)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove checkpointed WAL segment %d: %v", seg.seq, err)
+		}
 	}
+	w.sealed = remaining
+
+	return nil
 }
@@ -0,0 +1,138 @@
+package wal
+
+import (
+	"os"
+	"testing"
+)
+
+// TestWriteRotatesSegments verifies that writes past maxSegmentBytes roll
+// over into new segment files instead of growing one file unboundedly.
+func TestWriteRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenOrCreateWAL(dir, 64)
+	if err != nil {
+		t.Fatalf("OpenOrCreateWAL: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := w.Write([]byte("+"), []byte("key"), []byte("value")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	seqs, err := listSegmentSeqs(dir)
+	if err != nil {
+		t.Fatalf("listSegmentSeqs: %v", err)
+	}
+	if len(seqs) < 2 {
+		t.Fatalf("expected writes past maxSegmentBytes to rotate across multiple segments, got %d", len(seqs))
+	}
+}
+
+// TestCheckpointDeletesCoveredSegments verifies that checkpointing the
+// highest written LSN removes every sealed segment it fully covers and
+// leaves no unread entries behind.
+func TestCheckpointDeletesCoveredSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenOrCreateWAL(dir, 64)
+	if err != nil {
+		t.Fatalf("OpenOrCreateWAL: %v", err)
+	}
+
+	var lastLSN uint64
+	for i := 0; i < 20; i++ {
+		lsn, err := w.Write([]byte("+"), []byte("key"), []byte("value"))
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		lastLSN = lsn
+	}
+
+	seqsBefore, err := listSegmentSeqs(dir)
+	if err != nil {
+		t.Fatalf("listSegmentSeqs: %v", err)
+	}
+	if len(seqsBefore) < 2 {
+		t.Fatalf("expected multiple segments before checkpointing, got %d", len(seqsBefore))
+	}
+
+	if err := w.Checkpoint(lastLSN); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	seqsAfter, err := listSegmentSeqs(dir)
+	if err != nil {
+		t.Fatalf("listSegmentSeqs: %v", err)
+	}
+	if len(seqsAfter) != 1 {
+		t.Fatalf("expected checkpointing the highest LSN to collapse every sealed segment, got %d segments left", len(seqsAfter))
+	}
+
+	entries, err := w.ReadEntries()
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries left unread after checkpointing the highest LSN, got %d", len(entries))
+	}
+}
+
+// TestOpenOrCreateWALTruncatesTornTail verifies that a partial record left
+// by a crash mid-append is dropped, and the segment file truncated back to
+// its last good record, on reopen.
+func TestOpenOrCreateWALTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenOrCreateWAL(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenOrCreateWAL: %v", err)
+	}
+	if _, err := w.Write([]byte("+"), []byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Persist(); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	segPath := segmentPath(dir, 0)
+	info, err := os.Stat(segPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	// Simulate a crash mid-append: a partial record header claiming more
+	// payload than actually follows it.
+	f, err := os.OpenFile(segPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte{0x00, 0x00, 0x00, 0xFF, 0xAA, 0xBB, 0xCC, 0xDD, 0x01, 0x02}); err != nil {
+		t.Fatalf("Write torn tail: %v", err)
+	}
+	f.Close()
+
+	w2, err := OpenOrCreateWAL(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen OpenOrCreateWAL: %v", err)
+	}
+
+	entries, err := w2.ReadEntries()
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected the torn tail to be dropped, leaving the one good entry, got %d entries", len(entries))
+	}
+
+	newInfo, err := os.Stat(segPath)
+	if err != nil {
+		t.Fatalf("Stat after reopen: %v", err)
+	}
+	if newInfo.Size() != info.Size() {
+		t.Fatalf("expected reopen to truncate the torn tail back to %d bytes, got %d", info.Size(), newInfo.Size())
+	}
+
+	// The segment must still be writable after the truncation.
+	if _, err := w2.Write([]byte("+"), []byte("key2"), []byte("value2")); err != nil {
+		t.Fatalf("Write after reopen: %v", err)
+	}
+}
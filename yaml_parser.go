@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	diskstore "github.com/venky1306/LogDB/disk_store"
 	LsmTree "github.com/venky1306/LogDB/log_structured_merge_tree"
@@ -16,8 +18,44 @@ type ServerConfig struct {
 	Host            string          `yaml:"host"`
 	UDPPort         string          `yaml:"udp_port"`
 	UDPBufferSize   int             `yaml:"udp_buffer_size"`
+	MemcachedPort   string          `yaml:"memcached_port"`
+	TCPReadTimeout  Duration        `yaml:"tcp_read_timeout"`
+	TCPIdleTimeout  Duration        `yaml:"tcp_idle_timeout"`
 	DBEngineConfig  DBEngineConfig  `yaml:"db_engine,inline"`
 	DiskStoreConfig DiskStoreConfig `yaml:"disk_store,inline"`
+	Chaos           ChaosConfig     `yaml:"chaos"`
+}
+
+// ChaosConfig represents the optional fault-injection configuration applied
+// to accepted connections (see the chaos package).
+type ChaosConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	LinkSpeedBps   int     `yaml:"link_speed_bps"`
+	DropRate       float64 `yaml:"drop_rate"`
+	DisconnectRate float64 `yaml:"disconnect_rate"`
+}
+
+// Duration wraps time.Duration so it can be parsed from a YAML string such as
+// "30s" via time.ParseDuration, instead of requiring a raw integer of
+// nanoseconds.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, parsing the node's string value
+// with time.ParseDuration.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if value.Value == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("failed to parse duration %q: %v", value.Value, err)
+	}
+
+	d.Duration = parsed
+	return nil
 }
 
 // DiskStoreConfig represents the configuration for the disk store.
@@ -33,6 +71,7 @@ type DBEngineConfig struct {
 	BloomFilterCapacity           int     `yaml:"bloom_capacity"`
 	BloomFilterErrorRate          float64 `yaml:"bloom_error_rate"`
 	WalPath                       string  `yaml:"wal_path"`
+	MaxSegmentBytes               int64   `yaml:"max_segment_bytes"`
 }
 
 // ParseServerConfig parses the YAML config file.
@@ -84,10 +123,26 @@ func LoadServerConfig(configFile string) (ServerConfig, error) {
 		serverConfig.UDPBufferSize = DEFAULT_UDP_BUFFER_SIZE
 	}
 
+	if serverConfig.MemcachedPort == "" {
+		serverConfig.MemcachedPort = DEFAULT_MEMCACHED_PORT
+	}
+
+	if serverConfig.TCPReadTimeout.Duration == 0 {
+		serverConfig.TCPReadTimeout.Duration = DEFAULT_TCP_READ_TIMEOUT
+	}
+
+	if serverConfig.TCPIdleTimeout.Duration == 0 {
+		serverConfig.TCPIdleTimeout.Duration = DEFAULT_TCP_IDLE_TIMEOUT
+	}
+
 	if serverConfig.DBEngineConfig.WalPath == "" {
 		serverConfig.DBEngineConfig.WalPath = wal.DEFAULT_WAL_PATH
 	}
 
+	if serverConfig.DBEngineConfig.MaxSegmentBytes == 0 {
+		serverConfig.DBEngineConfig.MaxSegmentBytes = wal.DEFAULT_MAX_SEGMENT_BYTES
+	}
+
 	if serverConfig.DBEngineConfig.LSMTreeMaxElementsBeforeFlush == 0 {
 		serverConfig.DBEngineConfig.LSMTreeMaxElementsBeforeFlush = LsmTree.DEFAULT_MAX_ELEMENTS_BEFORE_FLUSH
 	}